@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/spf13/afero"
+)
+
+type cocoInfo struct {
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type cocoImage struct {
+	ID       int    `json:"id"`
+	FileName string `json:"file_name"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+type cocoAnnotation struct {
+	ID           int        `json:"id"`
+	ImageID      int        `json:"image_id"`
+	CategoryID   int        `json:"category_id"`
+	Bbox         [4]float64 `json:"bbox"`
+	Area         float64    `json:"area"`
+	Iscrowd      int        `json:"iscrowd"`
+	Segmentation []float64  `json:"segmentation"`
+}
+
+type cocoCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type cocoDataset struct {
+	Info        cocoInfo         `json:"info"`
+	Licenses    []interface{}    `json:"licenses"`
+	Images      []cocoImage      `json:"images"`
+	Annotations []cocoAnnotation `json:"annotations"`
+	Categories  []cocoCategory   `json:"categories"`
+}
+
+// cocoAccumulator collects images and annotations across the whole
+// scanAllLabelled walk so they can be written out as a single
+// instances.json document, since COCO (unlike VOC/YOLO) requires one JSON
+// file rather than one per sample.
+type cocoAccumulator struct {
+	dataset  cocoDataset
+	nextImg  int
+	nextAnno int
+}
+
+func newCOCOAccumulator() *cocoAccumulator {
+	return &cocoAccumulator{
+		dataset: cocoDataset{
+			Info:       cocoInfo{Description: "pbl2-2022 export", Version: "1.0"},
+			Licenses:   []interface{}{},
+			Categories: cocoCategories(),
+		},
+	}
+}
+
+func cocoCategories() []cocoCategory {
+	names := classNames()
+	categories := make([]cocoCategory, len(names))
+	for idx, name := range names {
+		categories[idx] = cocoCategory{ID: idx, Name: name}
+	}
+	return categories
+}
+
+func (c *cocoAccumulator) addImage(fileName string, width, height int) int {
+	id := c.nextImg
+	c.nextImg++
+
+	c.dataset.Images = append(c.dataset.Images, cocoImage{
+		ID:       id,
+		FileName: fileName,
+		Width:    width,
+		Height:   height,
+	})
+
+	return id
+}
+
+func (c *cocoAccumulator) addAnnotation(imageID, categoryID int, x, y, w, h float64) {
+	id := c.nextAnno
+	c.nextAnno++
+
+	c.dataset.Annotations = append(c.dataset.Annotations, cocoAnnotation{
+		ID:           id,
+		ImageID:      imageID,
+		CategoryID:   categoryID,
+		Bbox:         [4]float64{x, y, w, h},
+		Area:         w * h,
+		Iscrowd:      0,
+		Segmentation: []float64{},
+	})
+}
+
+// write marshals the accumulated dataset and writes it atomically: COCO
+// requires a single JSON document, so a crash mid-write must not leave a
+// truncated instances.json behind.
+func (c *cocoAccumulator) write(fs afero.Fs, path string) error {
+	b, err := json.MarshalIndent(c.dataset, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := afero.WriteFile(fs, tmp, b, 0644); err != nil {
+		return err
+	}
+
+	return fs.Rename(tmp, path)
+}
+
+// cocoBBox converts a single VOC object into an absolute-pixel COCO bbox.
+// It reports ok=false for boxes that can't be classified or that have
+// zero area, mirroring yoloLine's skip behavior.
+func cocoBBox(obj VOCObject, fallbackClassIndex ClassIndex) (categoryID int, x, y, w, h float64, ok bool) {
+	classIndex := getIndexFromPath(obj.Name)
+	if classIndex == -1 {
+		classIndex = fallbackClassIndex
+	}
+	if classIndex == -1 {
+		return 0, 0, 0, 0, 0, false
+	}
+
+	xMax, err1 := strconv.Atoi(obj.Bndbox.Xmax)
+	xMin, err2 := strconv.Atoi(obj.Bndbox.Xmin)
+	yMax, err3 := strconv.Atoi(obj.Bndbox.Ymax)
+	yMin, err4 := strconv.Atoi(obj.Bndbox.Ymin)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return 0, 0, 0, 0, 0, false
+	}
+
+	w = float64(xMax - xMin)
+	h = float64(yMax - yMin)
+	if w <= 0 || h <= 0 {
+		return 0, 0, 0, 0, 0, false
+	}
+
+	return classIndex, float64(xMin), float64(yMin), w, h, true
+}
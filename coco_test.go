@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestCOCOAccumulatorAssignsMonotonicIDs(t *testing.T) {
+	coco := newCOCOAccumulator()
+
+	img0 := coco.addImage("0.jpg", 100, 100)
+	img1 := coco.addImage("1.jpg", 200, 150)
+	if img0 != 0 || img1 != 1 {
+		t.Fatalf("image ids = %d, %d, want 0, 1", img0, img1)
+	}
+
+	coco.addAnnotation(img0, gunIndex, 10, 10, 40, 40)
+	coco.addAnnotation(img0, gunIndex, 60, 60, 30, 30)
+	coco.addAnnotation(img1, knifeIndex, 0, 0, 20, 20)
+
+	if len(coco.dataset.Annotations) != 3 {
+		t.Fatalf("got %d annotations, want 3", len(coco.dataset.Annotations))
+	}
+	for i, anno := range coco.dataset.Annotations {
+		if anno.ID != i {
+			t.Errorf("annotation %d has ID %d, want monotonic %d", i, anno.ID, i)
+		}
+	}
+
+	last := coco.dataset.Annotations[1]
+	if last.ImageID != img0 || last.Bbox != [4]float64{60, 60, 30, 30} || last.Area != 900 {
+		t.Errorf("annotation 1 = %+v, want image %d, bbox [60 60 30 30], area 900", last, img0)
+	}
+}
+
+func TestCOCOCategoriesMatchClassNames(t *testing.T) {
+	names := classNames()
+	categories := cocoCategories()
+
+	if len(categories) != len(names) {
+		t.Fatalf("got %d categories, want %d", len(categories), len(names))
+	}
+	for idx, name := range names {
+		if categories[idx].ID != idx || categories[idx].Name != name {
+			t.Errorf("category %d = %+v, want {ID:%d Name:%s}", idx, categories[idx], idx, name)
+		}
+	}
+}
+
+func TestConverterRunCOCOMultiObject(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "dataset/annotations/gun/2.xml", []byte(testVOCXMLMultiObject), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "dataset/images/gun/2.jpg", []byte("stub"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	converter := NewConverter(fs, "dataset", "output")
+	if err := converter.Run(FormatCOCO); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	b, err := afero.ReadFile(fs, "output/coco/instances.json")
+	if err != nil {
+		t.Fatalf("reading instances.json: %v", err)
+	}
+
+	var dataset cocoDataset
+	if err := json.Unmarshal(b, &dataset); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if len(dataset.Images) != 1 {
+		t.Fatalf("got %d images, want 1", len(dataset.Images))
+	}
+	if len(dataset.Annotations) != 2 {
+		t.Fatalf("got %d annotations, want 2 (one per <object>)", len(dataset.Annotations))
+	}
+	for _, anno := range dataset.Annotations {
+		if anno.ImageID != dataset.Images[0].ID {
+			t.Errorf("annotation image_id = %d, want %d", anno.ImageID, dataset.Images[0].ID)
+		}
+	}
+}
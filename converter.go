@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+	"golang.org/x/exp/slices"
+)
+
+// Converter holds all state for one VOC->{VOC,YOLO,COCO} conversion run: the
+// filesystem it reads and writes through, the dataset roots, and the
+// per-class counters that used to be package-level globals. Threading the
+// filesystem through as an afero.Fs (instead of calling os/filepath.WalkDir
+// directly) lets callers point a Converter at an afero.NewMemMapFs() in
+// tests instead of the real disk.
+type Converter struct {
+	Fs         afero.Fs
+	InputRoot  string
+	OutputRoot string
+
+	// Workers caps how many XML annotations ScanLabelled parses and copies
+	// concurrently. Zero (the default) uses runtime.NumCPU().
+	Workers int
+
+	GunCount         ClassCount
+	KnifeCount       ClassCount
+	WrenchCount      ClassCount
+	ForkCount        ClassCount
+	ScrewdriverCount ClassCount
+	UnknownCount     ClassCount
+	TotalCount       ClassCount
+
+	copiedMu     sync.Mutex
+	copiedImages []string
+	imageIndex   *imageIndex
+}
+
+// NewConverter returns a Converter reading VOC annotations/images from
+// inputRoot and writing every export under outputRoot, through fs.
+func NewConverter(fs afero.Fs, inputRoot, outputRoot string) *Converter {
+	return &Converter{
+		Fs:         fs,
+		InputRoot:  inputRoot,
+		OutputRoot: outputRoot,
+	}
+}
+
+// Run performs a full conversion: it emits labels in format, then copies
+// over any dataset images that weren't already copied as part of a
+// labelled sample.
+func (c *Converter) Run(format OutputFormat) error {
+	if err := c.ScanLabelled(format); err != nil {
+		return err
+	}
+	return c.ScanImages()
+}
+
+func (c *Converter) getClassFromPath(path string) (Class, *ClassCount) {
+	path = strings.ToLower(path)
+
+	if strings.Contains(path, GUN) {
+		return GUN, &c.GunCount
+	}
+
+	if strings.Contains(path, KNIFE) {
+		return KNIFE, &c.KnifeCount
+	}
+	if strings.Contains(path, WRENCH) {
+		return WRENCH, &c.WrenchCount
+	}
+	if strings.Contains(path, FORK) {
+		return FORK, &c.ForkCount
+	}
+	if strings.Contains(path, SCREWDRIVER) {
+		return SCREWDRIVER, &c.ScrewdriverCount
+	}
+
+	return UNKNOWN, &c.UnknownCount
+}
+
+// ScanImages copies every image under InputRoot/images that ScanLabelled
+// hasn't already copied as part of a labelled sample.
+func (c *Converter) ScanImages() error {
+	imagesRoot := filepath.Join(c.InputRoot, "images")
+
+	return afero.Walk(c.Fs, imagesRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		if !slices.Contains(c.copiedImages, path) {
+			class, classCount := c.getClassFromPath(path)
+			outputFile := c.getOutputFileName(class, *classCount, filepath.Ext(path))
+			if _, err := c.copy(path, outputFile); err != nil {
+				return err
+			}
+			*classCount++
+		}
+		return nil
+	})
+}
+
+func (c *Converter) copy(src, dst string) (int64, error) {
+	sourceFileStat, err := c.Fs.Stat(src)
+	if err != nil {
+		return 0, err
+	}
+
+	if !sourceFileStat.Mode().IsRegular() {
+		return 0, fmt.Errorf("%s is not a regular file", src)
+	}
+
+	source, err := c.Fs.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	destination, err := c.Fs.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer destination.Close()
+	nBytes, err := io.Copy(destination, source)
+
+	c.copiedMu.Lock()
+	c.copiedImages = append(c.copiedImages, src)
+	c.copiedMu.Unlock()
+
+	return nBytes, err
+}
+
+func (c *Converter) createOutputDir(dir ...string) string {
+	outputDir := filepath.Join(append([]string{c.OutputRoot}, dir...)...)
+	c.Fs.MkdirAll(outputDir, 0700)
+	return outputDir
+}
+
+func (c *Converter) getOutputFileName(class Class, classCount ClassCount, path string) string {
+	return filepath.Join(c.createOutputDir(class), strings.Join([]string{class, strconv.Itoa(classCount)}, "_")+filepath.Ext(path))
+}
+
+// ScanLabelled finds every VOC annotation XML under InputRoot and emits it
+// in format: rewritten VOC XML + copied image, YOLO label .txt + copied
+// image, or a single accumulated COCO instances.json. Parsing, bbox math
+// and image copying for each XML run concurrently across c.workerCount()
+// workers; a single collector then finalizes results (assigning
+// TotalCount/per-class indices and writing the .txt/.xml outputs) strictly
+// in sorted-path order, so output numbering doesn't depend on which
+// worker happens to finish first.
+func (c *Converter) ScanLabelled(format OutputFormat) error {
+	paths, err := c.collectAnnotationPaths()
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	// Build the image index once, up front, so workers only ever hit it
+	// with read-only lookups.
+	if _, err := c.ensureImageIndex(); err != nil {
+		return err
+	}
+
+	if format != FormatVOC {
+		c.createOutputDir(".staging")
+	}
+
+	results := c.runLabelWorkers(paths, format)
+
+	var coco *cocoAccumulator
+	if format == FormatCOCO {
+		coco = newCOCOAccumulator()
+	}
+
+	for _, res := range results {
+		if res.err != nil {
+			return res.err
+		}
+		if res.skip {
+			continue
+		}
+
+		if err := c.finalizeLabelResult(format, res, coco); err != nil {
+			return err
+		}
+	}
+
+	if format == FormatCOCO {
+		return coco.write(c.Fs, filepath.Join(c.createOutputDir("coco"), "instances.json"))
+	}
+
+	return nil
+}
+
+func (c *Converter) collectAnnotationPaths() ([]string, error) {
+	var paths []string
+
+	err := afero.Walk(c.Fs, c.InputRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(info.Name()) == ".xml" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(paths)
+
+	return paths, nil
+}
+
+func (c *Converter) readLabelled(filename string) (*labelledXML, error) {
+	file, err := c.Fs.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	labelled := &labelledXML{}
+	bounded := &boundedTokenReader{dec: xml.NewDecoder(file)}
+	if err := xml.NewTokenDecoder(bounded).Decode(labelled); err != nil {
+		return nil, err
+	}
+
+	return labelled, nil
+}
+
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+const testVOCXML = `<annotation>
+	<folder>gun</folder>
+	<filename>1.jpg</filename>
+	<path>dataset/images/gun/1.jpg</path>
+	<size>
+		<width>100</width>
+		<height>100</height>
+		<depth>3</depth>
+	</size>
+	<object>
+		<name>gun</name>
+		<bndbox>
+			<xmin>10</xmin>
+			<ymin>10</ymin>
+			<xmax>50</xmax>
+			<ymax>50</ymax>
+		</bndbox>
+	</object>
+</annotation>`
+
+func newTestFs(t *testing.T) afero.Fs {
+	t.Helper()
+
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "dataset/annotations/gun/1.xml", []byte(testVOCXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "dataset/images/gun/1.jpg", []byte("stub"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestConverterRunYOLO(t *testing.T) {
+	fs := newTestFs(t)
+	converter := NewConverter(fs, "dataset", "output")
+
+	if err := converter.Run(FormatYOLO); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	label, err := afero.ReadFile(fs, filepath.Join("output", "yolo", "0.txt"))
+	if err != nil {
+		t.Fatalf("reading label: %v", err)
+	}
+
+	const want = "2 0.300000 0.300000 0.400000 0.400000"
+	if string(label) != want {
+		t.Errorf("label = %q, want %q", string(label), want)
+	}
+
+	if ok, _ := afero.Exists(fs, filepath.Join("output", "yolo", "0.jpg")); !ok {
+		t.Error("expected copied image at output/yolo/0.jpg")
+	}
+}
+
+func TestConverterRunCOCO(t *testing.T) {
+	fs := newTestFs(t)
+	converter := NewConverter(fs, "dataset", "output")
+
+	if err := converter.Run(FormatCOCO); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if ok, _ := afero.Exists(fs, filepath.Join("output", "coco", "instances.json")); !ok {
+		t.Error("expected output/coco/instances.json to be written")
+	}
+}
+
+const testVOCXMLMultiObject = `<annotation>
+	<folder>gun</folder>
+	<filename>2.jpg</filename>
+	<path>dataset/images/gun/2.jpg</path>
+	<size>
+		<width>100</width>
+		<height>100</height>
+		<depth>3</depth>
+	</size>
+	<object>
+		<name>gun</name>
+		<bndbox>
+			<xmin>10</xmin>
+			<ymin>10</ymin>
+			<xmax>50</xmax>
+			<ymax>50</ymax>
+		</bndbox>
+	</object>
+	<object>
+		<name>gun</name>
+		<bndbox>
+			<xmin>60</xmin>
+			<ymin>60</ymin>
+			<xmax>90</xmax>
+			<ymax>90</ymax>
+		</bndbox>
+	</object>
+</annotation>`
+
+func TestConverterRunYOLOMultiObject(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "dataset/annotations/gun/2.xml", []byte(testVOCXMLMultiObject), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "dataset/images/gun/2.jpg", []byte("stub"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	converter := NewConverter(fs, "dataset", "output")
+	if err := converter.Run(FormatYOLO); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	label, err := afero.ReadFile(fs, filepath.Join("output", "yolo", "0.txt"))
+	if err != nil {
+		t.Fatalf("reading label: %v", err)
+	}
+
+	lines := strings.Split(string(label), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d YOLO lines, want 2 (one per <object>): %q", len(lines), string(label))
+	}
+}
+
+// testVOCXMLBadWidth has a non-numeric <width>, which strconv.Atoi rejects.
+const testVOCXMLBadWidth = `<annotation>
+	<folder>gun</folder>
+	<filename>0.jpg</filename>
+	<path>dataset/images/gun/0.jpg</path>
+	<size>
+		<width>notanumber</width>
+		<height>100</height>
+		<depth>3</depth>
+	</size>
+	<object>
+		<name>gun</name>
+		<bndbox>
+			<xmin>10</xmin>
+			<ymin>10</ymin>
+			<xmax>50</xmax>
+			<ymax>50</ymax>
+		</bndbox>
+	</object>
+</annotation>`
+
+func TestConverterRunSkipsMalformedAnnotationInsteadOfFailingBatch(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	// "0.xml" sorts before "1.xml", so the malformed annotation is
+	// processed first and must not stop the valid one behind it.
+	if err := afero.WriteFile(fs, "dataset/annotations/gun/0.xml", []byte(testVOCXMLBadWidth), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "dataset/images/gun/0.jpg", []byte("stub"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "dataset/annotations/gun/1.xml", []byte(testVOCXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "dataset/images/gun/1.jpg", []byte("stub"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	converter := NewConverter(fs, "dataset", "output")
+	if err := converter.Run(FormatYOLO); err != nil {
+		t.Fatalf("Run: %v, want the malformed annotation skipped rather than failing the batch", err)
+	}
+
+	if ok, _ := afero.Exists(fs, filepath.Join("output", "yolo", "0.txt")); !ok {
+		t.Error("expected the valid annotation to still be written despite the malformed one")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	"golang.org/x/exp/slices"
+)
+
+// imageEntryFingerprint is enough of an os.FileInfo to notice that a single
+// file under one of the image roots was added, removed, or modified since
+// the index was built. Fingerprinting every entry (rather than just the
+// two root directories) matters because images live in class subfolders
+// (dataset/images/<class>/...) whose own mtime doesn't change when a file
+// inside them is added or edited.
+type imageEntryFingerprint struct {
+	Path    string
+	ModTime int64
+	Size    int64
+}
+
+// imageIndex is a one-shot basename -> absolute paths index over
+// InputRoot/images and InputRoot/allimages, persisted so
+// findCorrespondingFile becomes a map lookup instead of a walk per XML
+// file (previously O(N*M) for N annotations over M images).
+type imageIndex struct {
+	Entries []imageEntryFingerprint
+	ByBase  map[string][]string
+}
+
+func (c *Converter) indexPath() string {
+	return filepath.Join(c.OutputRoot, ".image-index.gob")
+}
+
+func (c *Converter) imageRoots() []string {
+	return []string{
+		filepath.Join(c.InputRoot, "images"),
+		filepath.Join(c.InputRoot, "allimages"),
+	}
+}
+
+// scanImageRoots walks InputRoot/images and InputRoot/allimages exactly
+// once, building the basename -> paths index and a fingerprint of every
+// file entry (path, mtime, size) in the same pass.
+func (c *Converter) scanImageRoots() ([]imageEntryFingerprint, map[string][]string, error) {
+	var fingerprints []imageEntryFingerprint
+	byBase := make(map[string][]string)
+
+	for _, root := range c.imageRoots() {
+		err := afero.Walk(c.Fs, root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+
+			fingerprints = append(fingerprints, imageEntryFingerprint{
+				Path:    path,
+				ModTime: info.ModTime().UnixNano(),
+				Size:    info.Size(),
+			})
+			byBase[info.Name()] = append(byBase[info.Name()], path)
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+	}
+
+	slices.SortFunc(fingerprints, func(a, b imageEntryFingerprint) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return fingerprints, byBase, nil
+}
+
+func fingerprintsEqual(a, b []imageEntryFingerprint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Converter) loadImageIndex() (*imageIndex, error) {
+	file, err := c.Fs.Open(c.indexPath())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	idx := &imageIndex{}
+	if err := gob.NewDecoder(file).Decode(idx); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+func (c *Converter) saveImageIndex(idx *imageIndex) error {
+	c.createOutputDir()
+
+	file, err := c.Fs.Create(c.indexPath())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return gob.NewEncoder(file).Encode(idx)
+}
+
+// ensureImageIndex returns the basename -> paths index for
+// InputRoot/images and InputRoot/allimages, building and persisting it on
+// first use. Detecting staleness correctly requires a fingerprint of every
+// file under both roots (a subfolder's own mtime doesn't change when a
+// file inside it does), so this always walks the tree once, on every call
+// — the persisted .image-index.gob is a staleness check and a durable
+// record of the index, not a way to skip that walk.
+func (c *Converter) ensureImageIndex() (*imageIndex, error) {
+	if c.imageIndex != nil {
+		return c.imageIndex, nil
+	}
+
+	fingerprints, byBase, err := c.scanImageRoots()
+	if err != nil {
+		return nil, err
+	}
+
+	if cached, err := c.loadImageIndex(); err == nil && fingerprintsEqual(cached.Entries, fingerprints) {
+		c.imageIndex = cached
+		return cached, nil
+	}
+
+	idx := &imageIndex{Entries: fingerprints, ByBase: byBase}
+
+	if err := c.saveImageIndex(idx); err != nil {
+		return nil, err
+	}
+
+	c.imageIndex = idx
+	return idx, nil
+}
+
+// findCorrespondingFile looks up the image matching a VOC <path> value in
+// the prebuilt basename index. When a basename collides across multiple
+// subfolders, it prefers the candidate whose parent directory matches the
+// XML's <folder> field before falling back to the first match found.
+func (c *Converter) findCorrespondingFile(p, folder string) (string, error) {
+	baseName := filepath.Base(strings.ReplaceAll(p, "\\", "/"))
+
+	idx, err := c.ensureImageIndex()
+	if err != nil {
+		return "", err
+	}
+
+	candidates := idx.ByBase[baseName]
+	if len(candidates) == 0 {
+		return "", nil
+	}
+	if len(candidates) == 1 || folder == "" {
+		return candidates[0], nil
+	}
+
+	for _, candidate := range candidates {
+		if filepath.Base(filepath.Dir(candidate)) == folder {
+			return candidate, nil
+		}
+	}
+
+	return candidates[0], nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestEnsureImageIndexPicksUpNewFileInSubfolder(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "dataset/images/gun/1.jpg", []byte("stub"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first := NewConverter(fs, "dataset", "output")
+	if _, err := first.ensureImageIndex(); err != nil {
+		t.Fatalf("ensureImageIndex: %v", err)
+	}
+
+	if err := afero.WriteFile(fs, "dataset/images/gun/2.jpg", []byte("stub"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	second := NewConverter(fs, "dataset", "output")
+	idx, err := second.ensureImageIndex()
+	if err != nil {
+		t.Fatalf("ensureImageIndex: %v", err)
+	}
+
+	if len(idx.ByBase["2.jpg"]) == 0 {
+		t.Error("expected freshly added dataset/images/gun/2.jpg to be visible in a new Converter's index")
+	}
+}
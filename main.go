@@ -1,19 +1,14 @@
 package main
 
 import (
-	"bytes"
 	"encoding/xml"
+	"flag"
 	"fmt"
-	"io"
-	"io/fs"
-	"io/ioutil"
 	"log"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 
-	"golang.org/x/exp/slices"
+	"github.com/spf13/afero"
 )
 
 type labelledXML struct {
@@ -32,21 +27,25 @@ type labelledXML struct {
 		Height string `xml:"height"`
 		Depth  string `xml:"depth"`
 	} `xml:"size"`
-	Segmented string `xml:"segmented"`
-	Object    struct {
-		Text      string `xml:",chardata"`
-		Name      string `xml:"name"`
-		Pose      string `xml:"pose"`
-		Truncated string `xml:"truncated"`
-		Difficult string `xml:"difficult"`
-		Bndbox    struct {
-			Text string `xml:",chardata"`
-			Xmin string `xml:"xmin"`
-			Ymin string `xml:"ymin"`
-			Xmax string `xml:"xmax"`
-			Ymax string `xml:"ymax"`
-		} `xml:"bndbox"`
-	} `xml:"object"`
+	Segmented string      `xml:"segmented"`
+	Objects   []VOCObject `xml:"object"`
+}
+
+// VOCObject is a single <object> element inside a Pascal VOC annotation.
+// A labelledXML document can carry more than one of these.
+type VOCObject struct {
+	Text      string `xml:",chardata"`
+	Name      string `xml:"name"`
+	Pose      string `xml:"pose"`
+	Truncated string `xml:"truncated"`
+	Difficult string `xml:"difficult"`
+	Bndbox    struct {
+		Text string `xml:",chardata"`
+		Xmin string `xml:"xmin"`
+		Ymin string `xml:"ymin"`
+		Xmax string `xml:"xmax"`
+		Ymax string `xml:"ymax"`
+	} `xml:"bndbox"`
 }
 
 // Class is pseudo type for classes in dataset
@@ -75,22 +74,29 @@ const (
 	screwdriverIndex ClassIndex = 4
 )
 
-// File count of classes
-var (
-	GunCount         ClassCount = 0
-	KnifeCount       ClassCount = 0
-	WrenchCount      ClassCount = 0
-	ForkCount        ClassCount = 0
-	ScrewdriverCount ClassCount = 0
-	UnknownCount     ClassCount = 0
-	TotalCount       ClassCount = 0
-)
+// OutputFormat selects which label format ScanLabelled emits.
+type OutputFormat int
 
-var copiedImages = make([]string, 0)
+const (
+	FormatVOC OutputFormat = iota
+	FormatYOLO
+	FormatCOCO
+)
 
 func main() {
-	scanAllLabelled(true)
-	scanImages()
+	workers := flag.Int("j", 0, "maximum number of XML annotations to scan in parallel (default: runtime.NumCPU())")
+	flag.Parse()
+
+	converter := NewConverter(afero.NewOsFs(), "dataset", "output")
+	converter.Workers = *workers
+
+	if err := converter.Run(FormatYOLO); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := converter.SplitDataset(SplitRatios{Train: 0.8, Val: 0.1, Test: 0.1}, 42, true); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func getIndexFromPath(path string) ClassIndex {
@@ -116,216 +122,97 @@ func getIndexFromPath(path string) ClassIndex {
 	return -1
 }
 
-func getClassFromPath(path string) (Class, *ClassCount) {
-	path = strings.ToLower(path)
-
-	if strings.Contains(path, GUN) {
-		return GUN, &GunCount
-	}
-
-	if strings.Contains(path, KNIFE) {
-		return KNIFE, &KnifeCount
-	}
-	if strings.Contains(path, WRENCH) {
-		return WRENCH, &WrenchCount
+// yoloLine converts a single VOC object into a YOLO "class x y w h" line,
+// normalized and clipped into [0,1]. It reports ok=false for boxes that
+// can't be classified or that clip down to zero area, so callers can drop
+// them instead of writing bad rows into the label file.
+func yoloLine(obj VOCObject, width, height int, fallbackClassIndex ClassIndex) (string, bool) {
+	classIndex := getIndexFromPath(obj.Name)
+	if classIndex == -1 {
+		classIndex = fallbackClassIndex
 	}
-	if strings.Contains(path, FORK) {
-		return FORK, &ForkCount
+	if classIndex == -1 {
+		return "", false
 	}
-	if strings.Contains(path, SCREWDRIVER) {
-		return SCREWDRIVER, &ScrewdriverCount
+
+	xMax, err1 := strconv.Atoi(obj.Bndbox.Xmax)
+	xMin, err2 := strconv.Atoi(obj.Bndbox.Xmin)
+	yMax, err3 := strconv.Atoi(obj.Bndbox.Ymax)
+	yMin, err4 := strconv.Atoi(obj.Bndbox.Ymin)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return "", false
 	}
 
-	return UNKNOWN, &UnknownCount
-}
+	xMinC := clipEdge(float64(xMin), float64(width))
+	xMaxC := clipEdge(float64(xMax), float64(width))
+	yMinC := clipEdge(float64(yMin), float64(height))
+	yMaxC := clipEdge(float64(yMax), float64(height))
 
-func scanImages() {
-	err := filepath.WalkDir("dataset/images", func(path string, d fs.DirEntry, err error) error {
-		if !slices.Contains(copiedImages, path) {
-			class, classCount := getClassFromPath(path)
-			outputFile := getOutputFileName(class, *classCount, filepath.Ext(path))
-			copy(path, outputFile)
-			*classCount++
-		}
-		return nil
-	})
+	dw := 1.0 / float64(width)
+	dh := 1.0 / float64(height)
 
-	if err != nil {
-		log.Fatal(err)
-	}
-}
+	x := (xMinC + xMaxC) / 2.0 * dw
+	y := (yMinC + yMaxC) / 2.0 * dh
+	w := (xMaxC - xMinC) * dw
+	h := (yMaxC - yMinC) * dh
 
-func copy(src, dst string) (int64, error) {
-	sourceFileStat, err := os.Stat(src)
-	if err != nil {
-		return 0, err
+	if w <= 0 || h <= 0 {
+		return "", false
 	}
 
-	if !sourceFileStat.Mode().IsRegular() {
-		return 0, fmt.Errorf("%s is not a regular file", src)
-	}
+	return fmt.Sprintf("%d %f %f %f %f", classIndex, x, y, w, h), true
+}
 
-	source, err := os.Open(src)
-	if err != nil {
-		return 0, err
+// clipEdge clamps a box edge coordinate into [0,max], so a box that
+// extends past the image boundary is cropped to the frame instead of
+// keeping its out-of-bounds extent.
+func clipEdge(v, max float64) float64 {
+	if v < 0 {
+		return 0
 	}
-	defer source.Close()
-
-	destination, err := os.Create(dst)
-	if err != nil {
-		return 0, err
+	if v > max {
+		return max
 	}
-	defer destination.Close()
-	nBytes, err := io.Copy(destination, source)
-
-	copiedImages = append(copiedImages, src)
-	return nBytes, err
+	return v
 }
 
-func createOutputDir(dir string) string {
-	outputDir := filepath.Join("output", dir)
-	os.MkdirAll(outputDir, 0700)
-	return outputDir
-}
+// Bounds on the XML decode path so a malformed or deeply nested annotation
+// file can't hang the walker (mirrors the depth/token budgeting the Go team
+// added around encoding/xml).
+const (
+	maxXMLDepth  = 64
+	maxXMLTokens = 1 << 20
+)
 
-func getOutputFileName(class Class, classCount ClassCount, path string) string {
-	return filepath.Join(createOutputDir(class), strings.Join([]string{class, strconv.Itoa(classCount)}, "_")+filepath.Ext(path))
+// boundedTokenReader wraps an xml.Decoder's token stream and enforces a
+// nesting depth and total token budget, failing closed instead of letting
+// Decode recurse or loop unbounded.
+type boundedTokenReader struct {
+	dec   *xml.Decoder
+	depth int
+	count int
 }
 
-func scanAllLabelled(yolo bool) {
-	err := filepath.WalkDir("dataset", func(path string, d fs.DirEntry, err error) error {
-		if filepath.Ext(d.Name()) == ".xml" {
-
-			data, err := readLabelled(path)
-			if err != nil {
-				return err
-			}
-
-			if data == nil {
-				return fmt.Errorf("Cannot read XML: " + path)
-			}
-
-			class, classCount := getClassFromPath(path)
-			if class == UNKNOWN {
-				class, classCount = getClassFromPath(data.Path)
-			}
-
-			classIndex := getIndexFromPath(path)
-			if classIndex == -1 {
-				classIndex = getIndexFromPath(data.Path)
-			}
-
-			foundImage := findCorrespondingFile(data.Path)
-
-			if len(foundImage) != 0 {
-
-				if !yolo {
-					outputFile := getOutputFileName(class, *classCount, filepath.Ext(foundImage))
-					xmlOutFile := getOutputFileName(class, *classCount, filepath.Ext(path))
-
-					relativeImagePath, err := filepath.Rel(filepath.Dir(xmlOutFile), filepath.Dir(outputFile))
-					if err != nil {
-						return err
-					}
-
-					relativeImagePath = filepath.Join(relativeImagePath, filepath.Base(outputFile))
-
-					data.Path = relativeImagePath
-					data.Filename = filepath.Base(outputFile)
-					data.Object.Name = class
-
-					b, err := xml.MarshalIndent(data, "", "  ")
-					b = bytes.Replace(b, []byte("&#xA;"), []byte(""), -1)
-					b = bytes.Replace(b, []byte("&#x9;"), []byte(""), -1)
-
-					if err != nil {
-						return err
-					}
-
-					err = ioutil.WriteFile(xmlOutFile, b, 0644)
-					if err != nil {
-						return err
-					}
-
-					copy(foundImage, outputFile)
-					*classCount++
-				} else {
-					outputFile := filepath.Join(createOutputDir("yolo"), strconv.Itoa(TotalCount)+".jpg")
-					outputYoloFile := filepath.Join(createOutputDir("yolo"), strconv.Itoa(TotalCount)+".txt")
-
-					xMax, err := strconv.Atoi(data.Object.Bndbox.Xmax)
-					xMin, err := strconv.Atoi(data.Object.Bndbox.Xmin)
-					yMax, err := strconv.Atoi(data.Object.Bndbox.Ymax)
-					yMin, err := strconv.Atoi(data.Object.Bndbox.Ymin)
-
-					width, err := strconv.Atoi(data.Size.Width)
-					height, err := strconv.Atoi(data.Size.Height)
-
-					if err != nil {
-						return err
-					}
-
-					dw := 1.0 / float64(width)
-					dh := 1.0 / float64(height)
-					x := (float64(xMin+xMax))/2.0 - 1
-					y := (float64(yMin+yMax))/2.0 - 1
-					w := float64(xMax - xMin)
-					h := float64(yMax - yMin)
-
-					xStr := fmt.Sprintf("%f", (x * dw))
-					wStr := fmt.Sprintf("%f", (w * dw))
-					yStr := fmt.Sprintf("%f", (y * dh))
-					hStr := fmt.Sprintf("%f", (h * dh))
-
-					err = ioutil.WriteFile(outputYoloFile, []byte(strconv.Itoa(classIndex)+" "+xStr+" "+yStr+" "+wStr+" "+hStr), 0644)
-					if err != nil {
-						return err
-					}
-
-					copy(foundImage, outputFile)
-					TotalCount++
-				}
-
-			}
-
-		}
-		return nil
-	})
-
-	if err != nil {
-		log.Fatal(err)
+func (b *boundedTokenReader) Token() (xml.Token, error) {
+	b.count++
+	if b.count > maxXMLTokens {
+		return nil, fmt.Errorf("xml: token budget of %d exceeded", maxXMLTokens)
 	}
-}
 
-func readLabelled(filename string) (*labelledXML, error) {
-	file, err := os.Open(filename)
+	tok, err := b.dec.Token()
 	if err != nil {
-		return nil, err
+		return tok, err
 	}
 
-	labelled := &labelledXML{}
-	xml.NewDecoder(file).Decode(&labelled)
-
-	return labelled, nil
-}
-
-func findCorrespondingFile(p string) string {
-	baseName := filepath.Base(strings.ReplaceAll(p, "\\", "/"))
-
-	var found string
-
-	walker := func(path string, d fs.DirEntry, err error) error {
-		if !d.IsDir() && d.Name() == baseName {
-			found = path
+	switch tok.(type) {
+	case xml.StartElement:
+		b.depth++
+		if b.depth > maxXMLDepth {
+			return nil, fmt.Errorf("xml: max nesting depth of %d exceeded", maxXMLDepth)
 		}
-		return nil
-	}
-
-	filepath.WalkDir("dataset/images", walker)
-
-	if len(found) == 0 {
-		filepath.WalkDir("dataset/allimages", walker)
+	case xml.EndElement:
+		b.depth--
 	}
 
-	return found
+	return tok, nil
 }
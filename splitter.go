@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// SplitRatios describes how a YOLO dataset should be partitioned across the
+// train, val and test subsets. Train+Val+Test must sum to 1.
+type SplitRatios struct {
+	Train float64
+	Val   float64
+	Test  float64
+}
+
+func (r SplitRatios) validate() error {
+	total := r.Train + r.Val + r.Test
+	if total < 0.999 || total > 1.001 {
+		return fmt.Errorf("splitter: ratios must sum to 1, got %f", total)
+	}
+	return nil
+}
+
+// yoloSample is a single id ("0", "1", ...) produced by ScanLabelled's
+// YOLO path, together with the dominant class found in its label file.
+type yoloSample struct {
+	id    string
+	class ClassIndex
+}
+
+// SplitDataset partitions the flat OutputRoot/yolo directory produced by
+// ScanLabelled into OutputRoot/yolo/images/{train,val,test} and
+// OutputRoot/yolo/labels/{train,val,test}, then writes a data.yaml next to
+// them. When stratify is true, samples are bucketed by dominant class
+// before splitting so the per-class distribution in each split matches
+// ratios within +/-1 sample. seed makes the split reproducible.
+func (c *Converter) SplitDataset(ratios SplitRatios, seed int64, stratify bool) error {
+	if err := ratios.validate(); err != nil {
+		return err
+	}
+
+	yoloDir := c.createOutputDir("yolo")
+
+	samples, err := c.collectYOLOSamples(yoloDir)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("splitter: no YOLO samples found in %s", yoloDir)
+	}
+
+	var buckets map[ClassIndex][]yoloSample
+	if stratify {
+		buckets = bucketByClass(samples)
+	} else {
+		buckets = map[ClassIndex][]yoloSample{0: samples}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+
+	bucketKeys := make([]ClassIndex, 0, len(buckets))
+	for class := range buckets {
+		bucketKeys = append(bucketKeys, class)
+	}
+	sort.Slice(bucketKeys, func(i, j int) bool { return bucketKeys[i] < bucketKeys[j] })
+
+	assignment := make(map[string]string, len(samples))
+	for _, class := range bucketKeys {
+		for id, split := range assignSplits(buckets[class], ratios, rng) {
+			assignment[id] = split
+		}
+	}
+
+	if err := c.moveSplitFiles(yoloDir, assignment); err != nil {
+		return err
+	}
+
+	return c.writeDataYAML(yoloDir)
+}
+
+func (c *Converter) collectYOLOSamples(yoloDir string) ([]yoloSample, error) {
+	entries, err := afero.ReadDir(c.Fs, yoloDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []yoloSample
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".txt" {
+			continue
+		}
+
+		class, err := c.dominantClass(filepath.Join(yoloDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		samples = append(samples, yoloSample{
+			id:    strings.TrimSuffix(e.Name(), ".txt"),
+			class: class,
+		})
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].id < samples[j].id })
+
+	return samples, nil
+}
+
+// dominantClass returns the most frequent class index among a label
+// file's lines, ties broken by the lowest index so the result is stable.
+func (c *Converter) dominantClass(path string) (ClassIndex, error) {
+	file, err := c.Fs.Open(path)
+	if err != nil {
+		return -1, err
+	}
+	defer file.Close()
+
+	counts := make(map[ClassIndex]int)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		idx, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		counts[idx]++
+	}
+	if err := scanner.Err(); err != nil {
+		return -1, err
+	}
+
+	best, bestCount := -1, -1
+	for idx, count := range counts {
+		if count > bestCount || (count == bestCount && idx < best) {
+			best, bestCount = idx, count
+		}
+	}
+
+	return best, nil
+}
+
+func bucketByClass(samples []yoloSample) map[ClassIndex][]yoloSample {
+	buckets := make(map[ClassIndex][]yoloSample)
+	for _, s := range samples {
+		buckets[s.class] = append(buckets[s.class], s)
+	}
+	return buckets
+}
+
+// assignSplits shuffles a bucket with rng and slices it into train/val/test
+// so each split's share of the bucket matches ratios within one sample.
+func assignSplits(bucket []yoloSample, ratios SplitRatios, rng *rand.Rand) map[string]string {
+	shuffled := make([]yoloSample, len(bucket))
+	copy(shuffled, bucket)
+	rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	nTrain := int(math.Round(float64(len(shuffled)) * ratios.Train))
+	nVal := int(math.Round(float64(len(shuffled)) * ratios.Val))
+	if nTrain+nVal > len(shuffled) {
+		nVal = len(shuffled) - nTrain
+	}
+
+	assignment := make(map[string]string, len(shuffled))
+	for i, s := range shuffled {
+		switch {
+		case i < nTrain:
+			assignment[s.id] = "train"
+		case i < nTrain+nVal:
+			assignment[s.id] = "val"
+		default:
+			assignment[s.id] = "test"
+		}
+	}
+
+	return assignment
+}
+
+func (c *Converter) moveSplitFiles(yoloDir string, assignment map[string]string) error {
+	imagesRoot := filepath.Join(yoloDir, "images")
+	labelsRoot := filepath.Join(yoloDir, "labels")
+
+	for _, split := range []string{"train", "val", "test"} {
+		if err := c.Fs.MkdirAll(filepath.Join(imagesRoot, split), 0700); err != nil {
+			return err
+		}
+		if err := c.Fs.MkdirAll(filepath.Join(labelsRoot, split), 0700); err != nil {
+			return err
+		}
+	}
+
+	for id, split := range assignment {
+		if err := c.Fs.Rename(filepath.Join(yoloDir, id+".jpg"), filepath.Join(imagesRoot, split, id+".jpg")); err != nil {
+			return err
+		}
+		if err := c.Fs.Rename(filepath.Join(yoloDir, id+".txt"), filepath.Join(labelsRoot, split, id+".txt")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// classNames returns the dataset's classes ordered by their ClassIndex, so
+// data.yaml's names list lines up with the indices written into .txt files.
+func classNames() []Class {
+	byIndex := map[ClassIndex]Class{
+		knifeIndex:       KNIFE,
+		forkIndex:        FORK,
+		gunIndex:         GUN,
+		wrenchIndex:      WRENCH,
+		screwdriverIndex: SCREWDRIVER,
+	}
+
+	names := make([]Class, len(byIndex))
+	for idx, name := range byIndex {
+		names[idx] = name
+	}
+
+	return names
+}
+
+func (c *Converter) writeDataYAML(yoloDir string) error {
+	names := classNames()
+
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = strconv.Quote(n)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "path: %s\n", yoloDir)
+	fmt.Fprintf(&b, "train: images/train\n")
+	fmt.Fprintf(&b, "val: images/val\n")
+	fmt.Fprintf(&b, "test: images/test\n")
+	fmt.Fprintf(&b, "nc: %d\n", len(names))
+	fmt.Fprintf(&b, "names: [%s]\n", strings.Join(quoted, ", "))
+
+	return afero.WriteFile(c.Fs, filepath.Join(yoloDir, "data.yaml"), []byte(b.String()), 0644)
+}
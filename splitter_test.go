@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// seedYOLODataset writes n samples per class directly into output/yolo, as
+// if ScanLabelled(FormatYOLO) had already run.
+func seedYOLODataset(t *testing.T, fs afero.Fs, classes []ClassIndex, perClass int) {
+	t.Helper()
+
+	id := 0
+	for _, class := range classes {
+		for i := 0; i < perClass; i++ {
+			label := fmt.Sprintf("%d 0.5 0.5 0.2 0.2", class)
+			if err := afero.WriteFile(fs, filepath.Join("output", "yolo", fmt.Sprintf("%d.txt", id)), []byte(label), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := afero.WriteFile(fs, filepath.Join("output", "yolo", fmt.Sprintf("%d.jpg", id)), []byte("stub"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			id++
+		}
+	}
+}
+
+// splitAssignment reads back which split each sample landed in after
+// SplitDataset moved it out of output/yolo.
+func splitAssignment(t *testing.T, fs afero.Fs) map[string]string {
+	t.Helper()
+
+	assignment := make(map[string]string)
+	for _, split := range []string{"train", "val", "test"} {
+		entries, err := afero.ReadDir(fs, filepath.Join("output", "yolo", "labels", split))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			id := e.Name()[:len(e.Name())-len(filepath.Ext(e.Name()))]
+			assignment[id] = split
+		}
+	}
+	return assignment
+}
+
+func runSplit(t *testing.T) map[string]string {
+	t.Helper()
+
+	fs := afero.NewMemMapFs()
+	seedYOLODataset(t, fs, []ClassIndex{knifeIndex, forkIndex, gunIndex, wrenchIndex, screwdriverIndex}, 12)
+
+	converter := NewConverter(fs, "dataset", "output")
+	if err := converter.SplitDataset(SplitRatios{Train: 0.8, Val: 0.1, Test: 0.1}, 42, true); err != nil {
+		t.Fatalf("SplitDataset: %v", err)
+	}
+
+	return splitAssignment(t, fs)
+}
+
+func TestSplitDatasetIsReproducibleForAFixedSeed(t *testing.T) {
+	first := runSplit(t)
+
+	// Bucket order depends on Go's randomized map iteration, so a single
+	// rerun can coincidentally land on the same assignment; repeat enough
+	// times that a non-deterministic bucket order reliably surfaces.
+	for attempt := 0; attempt < 10; attempt++ {
+		next := runSplit(t)
+		if len(first) != len(next) {
+			t.Fatalf("assignment sizes differ: %d vs %d", len(first), len(next))
+		}
+		for id, split := range first {
+			if next[id] != split {
+				t.Fatalf("attempt %d: sample %s: run1=%s rerun=%s, want identical assignment for the same seed", attempt, id, split, next[id])
+			}
+		}
+	}
+}
+
+func TestSplitDatasetStratifiesWithinOneSample(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	classes := []ClassIndex{knifeIndex, forkIndex, gunIndex, wrenchIndex, screwdriverIndex}
+	seedYOLODataset(t, fs, classes, 10)
+
+	converter := NewConverter(fs, "dataset", "output")
+	if err := converter.SplitDataset(SplitRatios{Train: 0.8, Val: 0.1, Test: 0.1}, 7, true); err != nil {
+		t.Fatalf("SplitDataset: %v", err)
+	}
+
+	assignment := splitAssignment(t, fs)
+	counts := map[string]int{}
+	for _, split := range assignment {
+		counts[split]++
+	}
+
+	// 10 samples per class * 5 classes = 50, with 0.8/0.1/0.1 ratios stratify
+	// should land each split within +/-1 of its exact share (40/5/5).
+	if want := 40; abs(counts["train"]-want) > 1 {
+		t.Errorf("train count = %d, want within 1 of %d", counts["train"], want)
+	}
+	if want := 5; abs(counts["val"]-want) > 1 {
+		t.Errorf("val count = %d, want within 1 of %d", counts["val"], want)
+	}
+	if want := 5; abs(counts["test"]-want) > 1 {
+		t.Errorf("test count = %d, want within 1 of %d", counts["test"], want)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// labelResult is everything runLabelWorkers' parse phase computes for one
+// XML annotation. finalizeLabelResult turns it into the actual .txt/.xml
+// output once the collector has assigned it a deterministic position.
+type labelResult struct {
+	path string
+	err  error
+	skip bool
+
+	data       *labelledXML
+	class      Class
+	classCount *ClassCount
+	classIndex ClassIndex
+	foundImage string
+	stagedPath string
+
+	width, height int
+	yoloLines     []string
+	cocoBoxes     []cocoBoxResult
+}
+
+// cocoBoxResult is one object's absolute-pixel COCO bbox, computed during
+// the parallel parse phase and turned into an annotation by the collector.
+type cocoBoxResult struct {
+	categoryID int
+	x, y, w, h float64
+}
+
+func (c *Converter) workerCount() int {
+	if c.Workers > 0 {
+		return c.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// runLabelWorkers parses, does the bbox math for, and (for YOLO/COCO)
+// stages a copy of the image for every path, spread across a bounded
+// worker pool. Results are returned in the same order as paths regardless
+// of which worker finished first, so the caller can finalize them
+// deterministically.
+func (c *Converter) runLabelWorkers(paths []string, format OutputFormat) []labelResult {
+	results := make([]labelResult, len(paths))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < c.workerCount(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = c.parseLabelJob(paths[i], i, format)
+			}
+		}()
+	}
+
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	return results
+}
+
+// parseLabelJob does the parallelizable work for one annotation: reading
+// and decoding the XML, the bbox math, and staging a copy of the matched
+// image under a name derived from index (fixed by the caller's sort, not
+// by completion order) so concurrent workers never collide.
+func (c *Converter) parseLabelJob(path string, index int, format OutputFormat) labelResult {
+	data, err := c.readLabelled(path)
+	if err != nil {
+		log.Printf("skipping %s: %v", path, err)
+		return labelResult{path: path, skip: true}
+	}
+
+	class, classCount := c.getClassFromPath(path)
+	if class == UNKNOWN {
+		class, classCount = c.getClassFromPath(data.Path)
+	}
+
+	classIndex := getIndexFromPath(path)
+	if classIndex == -1 {
+		classIndex = getIndexFromPath(data.Path)
+	}
+
+	foundImage, err := c.findCorrespondingFile(data.Path, data.Folder)
+	if err != nil {
+		return labelResult{path: path, err: err}
+	}
+	if len(foundImage) == 0 {
+		return labelResult{path: path, skip: true}
+	}
+
+	res := labelResult{
+		path:       path,
+		data:       data,
+		class:      class,
+		classCount: classCount,
+		classIndex: classIndex,
+		foundImage: foundImage,
+	}
+
+	if format != FormatVOC {
+		width, err := strconv.Atoi(data.Size.Width)
+		if err != nil {
+			log.Printf("skipping %s: invalid <width>: %v", path, err)
+			return labelResult{path: path, skip: true}
+		}
+		height, err := strconv.Atoi(data.Size.Height)
+		if err != nil {
+			log.Printf("skipping %s: invalid <height>: %v", path, err)
+			return labelResult{path: path, skip: true}
+		}
+		res.width, res.height = width, height
+	}
+
+	switch format {
+	case FormatYOLO:
+		for _, obj := range data.Objects {
+			line, ok := yoloLine(obj, res.width, res.height, classIndex)
+			if ok {
+				res.yoloLines = append(res.yoloLines, line)
+			}
+		}
+		if len(res.yoloLines) == 0 {
+			return labelResult{path: path, skip: true}
+		}
+	case FormatCOCO:
+		for _, obj := range data.Objects {
+			categoryID, x, y, w, h, ok := cocoBBox(obj, classIndex)
+			if !ok {
+				continue
+			}
+			res.cocoBoxes = append(res.cocoBoxes, cocoBoxResult{categoryID, x, y, w, h})
+		}
+		if len(res.cocoBoxes) == 0 {
+			return labelResult{path: path, skip: true}
+		}
+	}
+
+	if format != FormatVOC {
+		stagedPath := filepath.Join(c.createOutputDir(".staging"), strconv.Itoa(index)+filepath.Ext(foundImage))
+		if _, err := c.copy(foundImage, stagedPath); err != nil {
+			return labelResult{path: path, err: err}
+		}
+		res.stagedPath = stagedPath
+	}
+
+	return res
+}
+
+// finalizeLabelResult writes the actual output for one parsed annotation.
+// It runs single-threaded, in sorted-path order, so it's the only place
+// that assigns TotalCount/per-class indices and mutates the coco
+// accumulator.
+func (c *Converter) finalizeLabelResult(format OutputFormat, res labelResult, coco *cocoAccumulator) error {
+	switch format {
+	case FormatVOC:
+		return c.finalizeVOC(res)
+	case FormatYOLO:
+		return c.finalizeYOLO(res)
+	case FormatCOCO:
+		return c.finalizeCOCO(res, coco)
+	}
+	return nil
+}
+
+func (c *Converter) finalizeVOC(res labelResult) error {
+	data := res.data
+
+	outputFile := c.getOutputFileName(res.class, *res.classCount, filepath.Ext(res.foundImage))
+	xmlOutFile := c.getOutputFileName(res.class, *res.classCount, filepath.Ext(res.path))
+
+	relativeImagePath, err := filepath.Rel(filepath.Dir(xmlOutFile), filepath.Dir(outputFile))
+	if err != nil {
+		log.Printf("skipping %s: can't relate output paths: %v", res.path, err)
+		return nil
+	}
+	relativeImagePath = filepath.Join(relativeImagePath, filepath.Base(outputFile))
+
+	data.Path = relativeImagePath
+	data.Filename = filepath.Base(outputFile)
+
+	b, err := xml.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = bytes.Replace(b, []byte("&#xA;"), []byte(""), -1)
+	b = bytes.Replace(b, []byte("&#x9;"), []byte(""), -1)
+
+	if err := afero.WriteFile(c.Fs, xmlOutFile, b, 0644); err != nil {
+		return err
+	}
+
+	if _, err := c.copy(res.foundImage, outputFile); err != nil {
+		return err
+	}
+	*res.classCount++
+
+	return nil
+}
+
+func (c *Converter) finalizeYOLO(res labelResult) error {
+	outputFile := filepath.Join(c.createOutputDir("yolo"), strconv.Itoa(c.TotalCount)+".jpg")
+	outputYoloFile := filepath.Join(c.createOutputDir("yolo"), strconv.Itoa(c.TotalCount)+".txt")
+
+	if err := afero.WriteFile(c.Fs, outputYoloFile, []byte(strings.Join(res.yoloLines, "\n")), 0644); err != nil {
+		return err
+	}
+	if err := c.Fs.Rename(res.stagedPath, outputFile); err != nil {
+		return err
+	}
+	c.TotalCount++
+
+	return nil
+}
+
+func (c *Converter) finalizeCOCO(res labelResult, coco *cocoAccumulator) error {
+	outputFile := filepath.Join(c.createOutputDir("coco", "images"), strconv.Itoa(c.TotalCount)+".jpg")
+	imageID := coco.addImage(filepath.Base(outputFile), res.width, res.height)
+
+	if err := c.Fs.Rename(res.stagedPath, outputFile); err != nil {
+		return err
+	}
+	c.TotalCount++
+
+	for _, box := range res.cocoBoxes {
+		coco.addAnnotation(imageID, box.categoryID, box.x, box.y, box.w, box.h)
+	}
+
+	return nil
+}